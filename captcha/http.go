@@ -0,0 +1,52 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+type verifyResponse struct {
+	Success bool     `json:"success"`
+	Score   *float64 `json:"score"`
+}
+
+// verifyViaForm POSTs form to verifyUrl and interprets the provider's
+// success/score response. Score is a pointer so a provider that omits the
+// field (no risk scoring) can be told apart from one that returns a genuine
+// 0.0 — the strongest possible bot signal from reCAPTCHA v3 — which must
+// not be coerced into the maximum-trust value 1.
+func verifyViaForm(verifyUrl string, form url.Values) (float64, bool, error) {
+	resp, err := http.PostForm(verifyUrl, form)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	var result verifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, false, err
+	}
+
+	if !result.Success {
+		return 0, false, nil
+	}
+	if result.Score == nil {
+		return 1, true, nil
+	}
+	return *result.Score, true, nil
+}
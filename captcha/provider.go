@@ -0,0 +1,57 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package captcha provides a pluggable abstraction over third-party CAPTCHA
+// services (hCaptcha, reCAPTCHA, Turnstile), mirroring the cred.CredManager
+// pattern used for password hashing providers.
+package captcha
+
+// Provider verifies a CAPTCHA response token against the issuing service.
+// score is only meaningful for providers that support risk scoring (e.g.
+// reCAPTCHA v3); implementations that don't should return 1 when ok is true.
+type Provider interface {
+	Verify(token string, remoteIp string) (score float64, ok bool, err error)
+}
+
+// ProviderTypeDefault identifies Casdoor's own built-in image captcha. It is
+// intentionally NOT handled by GetCaptchaProvider: its challenge/response is
+// checked against object.GenerateDefaultCaptcha's session store, not a
+// third-party verify API, so it must never be routed through this package's
+// Provider abstraction. Callers that see this type should keep using
+// object.VerifyCaptcha's built-in handling of it instead of asking
+// GetCaptchaProvider below for a Provider.
+const ProviderTypeDefault = "Default"
+
+const (
+	ProviderTypeHCaptcha       = "hCaptcha"
+	ProviderTypeRecaptchaV2    = "reCAPTCHA v2"
+	ProviderTypeRecaptchaV3    = "reCAPTCHA v3"
+	ProviderTypeCloudflareTurn = "Cloudflare Turnstile"
+)
+
+// GetCaptchaProvider returns the Provider implementation for the given
+// ProviderItem type, or nil if the type is unrecognized or is
+// ProviderTypeDefault.
+func GetCaptchaProvider(providerType, clientId, clientSecret string) Provider {
+	switch providerType {
+	case ProviderTypeHCaptcha:
+		return NewHCaptchaProvider(clientSecret)
+	case ProviderTypeRecaptchaV2, ProviderTypeRecaptchaV3:
+		return NewRecaptchaProvider(clientSecret)
+	case ProviderTypeCloudflareTurn:
+		return NewTurnstileProvider(clientSecret)
+	default:
+		return nil
+	}
+}
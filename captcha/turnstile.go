@@ -0,0 +1,35 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import "net/url"
+
+const turnstileVerifyUrl = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+
+type TurnstileProvider struct {
+	Secret string
+}
+
+func NewTurnstileProvider(secret string) *TurnstileProvider {
+	return &TurnstileProvider{Secret: secret}
+}
+
+func (p *TurnstileProvider) Verify(token string, remoteIp string) (float64, bool, error) {
+	form := url.Values{}
+	form.Set("secret", p.Secret)
+	form.Set("response", token)
+	form.Set("remoteip", remoteIp)
+	return verifyViaForm(turnstileVerifyUrl, form)
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"github.com/casdoor/casdoor/object"
+)
+
+// UnlockUser
+// @Title UnlockUser
+// @Tag User API
+// @Description unlock a user that is currently locked out due to too many failed signin attempts
+// @Param   id     query    string  true        "The id ( owner/name ) of the user"
+// @Success 200 {object} controllers.Response The Response object
+// @router /unlock-user [post]
+func (c *ApiController) UnlockUser() {
+	id := c.Input().Get("id")
+
+	requestUserId := c.GetSessionUsername()
+	hasPermission, err := object.CheckUserPermission(requestUserId, id, "", true, c.GetAcceptLanguage())
+	if !hasPermission {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	user := object.GetUser(id)
+	if user == nil {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+
+	err = object.UnlockUser(user)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.ResponseOk()
+}
+
+// GetLockedUsers
+// @Title GetLockedUsers
+// @Tag User API
+// @Description get all users in an organization that are currently locked out
+// @Param   owner     query    string  true        "The owner of the users"
+// @Success 200 {object} controllers.Response The Response object
+// @router /locked-users [get]
+func (c *ApiController) GetLockedUsers() {
+	owner := c.Input().Get("owner")
+
+	requestUserId := c.GetSessionUsername()
+	hasPermission, err := object.CheckUserPermission(requestUserId, "", owner, true, c.GetAcceptLanguage())
+	if !hasPermission {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	lockedUsers, err := object.GetLockedUsers(owner)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.ResponseOk(lockedUsers)
+}
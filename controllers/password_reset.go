@@ -0,0 +1,57 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"github.com/casdoor/casdoor/object"
+)
+
+// SetPassword
+// @Title SetPassword
+// @Tag User API
+// @Description set a user's password, either as an admin resetting another
+// user's password or as the user performing a self-service reset. Both
+// paths go through object.SetUserPassword so neither can bypass the
+// organization's PasswordPolicy the way signup already enforces it.
+// @Param   id              query    string  true        "The id ( owner/name ) of the user"
+// @Param   newPassword     query    string  true        "The new password"
+// @Success 200 {object} controllers.Response The Response object
+// @router /set-password [post]
+func (c *ApiController) SetPassword() {
+	id := c.Input().Get("id")
+	newPassword := c.Input().Get("newPassword")
+	lang := c.GetAcceptLanguage()
+
+	requestUserId := c.GetSessionUsername()
+	hasPermission, err := object.CheckUserPermission(requestUserId, id, "", true, lang)
+	if !hasPermission {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	user := object.GetUser(id)
+	if user == nil {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+
+	organization := object.GetOrganizationByUser(user)
+	if msg := object.SetUserPassword(organization, user, newPassword, lang); msg != "" {
+		c.ResponseError(msg)
+		return
+	}
+
+	c.ResponseOk()
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"github.com/casdoor/casdoor/object"
+)
+
+// GetCaptcha
+// @Title GetCaptcha
+// @Tag Login API
+// @Description issue a new default-image-captcha challenge for the caller's session
+// @Success 200 {object} controllers.Response The Response object
+// @router /get-captcha [get]
+func (c *ApiController) GetCaptcha() {
+	answer := object.GenerateDefaultCaptcha(c.Ctx.Input.CruSession.SessionID())
+	c.ResponseOk(answer)
+}
+
+// Login
+// @Title Login
+// @Tag Login API
+// @Description sign in with a username/password pair, challenging with a captcha first when the application's risk rules require it
+// @Param   application     query    string  true        "The application the user is signing into"
+// @Param   organization    query    string  true        "The organization of the user"
+// @Param   username        query    string  true        "The username"
+// @Param   password        query    string  true        "The password"
+// @Param   captchaToken    query    string  false       "The captcha response token, if the previous attempt required one"
+// @Success 200 {object} controllers.Response The Response object
+// @router /login [post]
+func (c *ApiController) Login() {
+	applicationName := c.Input().Get("application")
+	organizationName := c.Input().Get("organization")
+	username := c.Input().Get("username")
+	password := c.Input().Get("password")
+	captchaToken := c.Input().Get("captchaToken")
+	remoteIp := c.Ctx.Input.IP()
+	lang := c.GetAcceptLanguage()
+
+	application := object.GetApplication(applicationName)
+	if application == nil {
+		c.ResponseError(c.T("AppErr.DoNotExist"))
+		return
+	}
+
+	captchaDecision := object.CheckToEnableCaptcha(application, username, remoteIp)
+	sessionId := c.Ctx.Input.CruSession.SessionID()
+	if msg := object.VerifyCaptcha(captchaDecision, captchaToken, remoteIp, sessionId, lang); msg != "" {
+		c.ResponseError(msg)
+		return
+	}
+
+	user, msg, requiresTwoFactor := object.CheckUserPassword(organizationName, username, password, lang, remoteIp)
+	if msg != "" {
+		c.ResponseError(msg)
+		return
+	}
+	if requiresTwoFactor {
+		c.ResponseOk(map[string]interface{}{"requiresTwoFactor": "webauthn", "owner": user.Owner, "name": user.Name})
+		return
+	}
+
+	c.SetSessionUsername(user.GetId())
+	c.ResponseOk(user)
+}
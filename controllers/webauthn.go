@@ -0,0 +1,200 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"github.com/casdoor/casdoor/object"
+)
+
+// WebAuthnSignupBegin
+// @Title WebAuthnSignupBegin
+// @Tag User API
+// @Description begin registering a new WebAuthn/FIDO2 credential for the signed-in user
+// @Success 200 {object} controllers.Response The Response object
+// @router /webauthn/signup/begin [get]
+func (c *ApiController) WebAuthnSignupBegin() {
+	user := object.GetUser(c.GetSessionUsername())
+	if user == nil {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+
+	webAuthnUser := object.NewWebauthnUser(user)
+	options, sessionData, err := object.GetWebAuthnInstance().BeginRegistration(webAuthnUser)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	object.StoreWebauthnSessionData(c.Ctx.Input.CruSession.SessionID(), sessionData)
+	c.ResponseOk(options)
+}
+
+// WebAuthnSignupFinish
+// @Title WebAuthnSignupFinish
+// @Tag User API
+// @Description finish registering a new WebAuthn/FIDO2 credential for the signed-in user
+// @Success 200 {object} controllers.Response The Response object
+// @router /webauthn/signup/finish [post]
+func (c *ApiController) WebAuthnSignupFinish() {
+	user := object.GetUser(c.GetSessionUsername())
+	if user == nil {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+
+	sessionData, ok := object.PopWebauthnSessionData(c.Ctx.Input.CruSession.SessionID())
+	if !ok {
+		c.ResponseError(c.T("WebAuthnErr.ChallengeExpired"))
+		return
+	}
+
+	webAuthnUser := object.NewWebauthnUser(user)
+	credential, err := object.GetWebAuthnInstance().FinishRegistration(webAuthnUser, *sessionData, c.Ctx.Request)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	userCredential := object.NewUserCredentialFromWebauthn(user, credential, c.Input().Get("displayName"))
+	_, err = object.AddUserCredential(userCredential)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.ResponseOk()
+}
+
+// WebAuthnSigninBegin
+// @Title WebAuthnSigninBegin
+// @Tag Login API
+// @Description begin a WebAuthn assertion, either as a second factor or as a passwordless primary signin
+// @Param   owner     query    string  true        "The owner of the user"
+// @Param   name      query    string  true        "The name of the user"
+// @Success 200 {object} controllers.Response The Response object
+// @router /webauthn/signin/begin [get]
+func (c *ApiController) WebAuthnSigninBegin() {
+	owner := c.Input().Get("owner")
+	name := c.Input().Get("name")
+
+	user := object.GetUserByFields(owner, name)
+	if user == nil || user.IsDeleted {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+	if user.IsForbidden {
+		c.ResponseError(c.T("LoginErr.UserIsForbidden"))
+		return
+	}
+
+	webAuthnUser := object.NewWebauthnUser(user)
+	options, sessionData, err := object.GetWebAuthnInstance().BeginLogin(webAuthnUser)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	object.StoreWebauthnSessionData(c.Ctx.Input.CruSession.SessionID(), sessionData)
+	c.ResponseOk(options)
+}
+
+// WebAuthnSigninFinish
+// @Title WebAuthnSigninFinish
+// @Tag Login API
+// @Description finish a WebAuthn assertion and sign the user in
+// @Param   owner     query    string  true        "The owner of the user"
+// @Param   name      query    string  true        "The name of the user"
+// @Success 200 {object} controllers.Response The Response object
+// @router /webauthn/signin/finish [post]
+func (c *ApiController) WebAuthnSigninFinish() {
+	owner := c.Input().Get("owner")
+	name := c.Input().Get("name")
+
+	user := object.GetUserByFields(owner, name)
+	if user == nil || user.IsDeleted {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+	if user.IsForbidden {
+		c.ResponseError(c.T("LoginErr.UserIsForbidden"))
+		return
+	}
+
+	sessionData, ok := object.PopWebauthnSessionData(c.Ctx.Input.CruSession.SessionID())
+	if !ok {
+		c.ResponseError(c.T("WebAuthnErr.ChallengeExpired"))
+		return
+	}
+
+	webAuthnUser := object.NewWebauthnUser(user)
+	credential, err := object.GetWebAuthnInstance().FinishLogin(webAuthnUser, *sessionData, c.Ctx.Request)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	userCredential := object.GetUserCredentialByWebauthnId(user, credential.ID)
+	if userCredential == nil {
+		c.ResponseError(c.T("WebAuthnErr.CredentialNotFound"))
+		return
+	}
+	if object.CheckCredentialCloning(userCredential, credential.Authenticator.SignCount) {
+		c.ResponseError(c.T("WebAuthnErr.CloningDetected"))
+		return
+	}
+	if err = object.UpdateUserCredentialUsage(userCredential, credential.Authenticator.SignCount); err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.SetSessionUsername(user.GetId())
+	c.ResponseOk(user)
+}
+
+// RevokeWebAuthnCredential
+// @Title RevokeWebAuthnCredential
+// @Tag User API
+// @Description revoke one of the signed-in user's enrolled WebAuthn credentials
+// @Param   id     query    string  true        "The id of the credential"
+// @Success 200 {object} controllers.Response The Response object
+// @router /webauthn/credential/revoke [post]
+func (c *ApiController) RevokeWebAuthnCredential() {
+	id, err := c.GetInt64("id")
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	user := object.GetUser(c.GetSessionUsername())
+	if user == nil {
+		c.ResponseError(c.T("UserErr.DoNotExist"))
+		return
+	}
+
+	credential := object.GetUserCredentialById(id)
+	if credential == nil || credential.Owner != user.Owner || credential.Name != user.Name {
+		c.ResponseError(c.T("WebAuthnErr.CredentialNotFound"))
+		return
+	}
+
+	_, err = object.RevokeUserCredential(id)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.ResponseOk()
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+// AuditLog records a single security-relevant event, such as a lockout or
+// unlock, for later review by organization admins.
+type AuditLog struct {
+	Id          int64  `xorm:"pk autoincr" json:"id"`
+	Owner       string `xorm:"varchar(100) index" json:"owner"`
+	User        string `xorm:"varchar(100) index" json:"user"`
+	Action      string `xorm:"varchar(100)" json:"action"`
+	Detail      string `xorm:"varchar(500)" json:"detail"`
+	CreatedTime string `xorm:"varchar(100)" json:"createdTime"`
+}
+
+// AddAuditLog persists a single audit log entry. Failures are intentionally
+// swallowed by callers that treat auditing as best-effort.
+func AddAuditLog(record *AuditLog) bool {
+	affected, err := adapter.Engine.Insert(record)
+	if err != nil {
+		return false
+	}
+	return affected != 0
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor/captcha"
+	"github.com/casdoor/casdoor/i18n"
+)
+
+// defaultCaptchaTtl bounds how long a generated default-image-captcha
+// challenge stays valid before the session must request a new one.
+const defaultCaptchaTtl = 5 * time.Minute
+
+type defaultCaptchaEntry struct {
+	answer    string
+	expiresAt time.Time
+}
+
+// defaultCaptchaStore holds in-flight default-image-captcha answers keyed by
+// session id, mirroring webauthnChallengeStore in object/webauthn.go: the
+// answer must survive between GenerateDefaultCaptcha and VerifyCaptcha
+// without ever being sent back to the client itself.
+type defaultCaptchaStore struct {
+	mu      sync.Mutex
+	entries map[string]*defaultCaptchaEntry
+}
+
+var defaultCaptchaSessions = &defaultCaptchaStore{entries: map[string]*defaultCaptchaEntry{}}
+
+// GenerateDefaultCaptcha issues a new challenge for Casdoor's built-in image
+// captcha and remembers the answer against sessionId so a later VerifyCaptcha
+// call can check a submission without round-tripping the answer through the
+// client. It returns the answer for the caller to render into an image;
+// rendering itself is outside this package.
+func GenerateDefaultCaptcha(sessionId string) string {
+	digits := make([]byte, 5)
+	for i := range digits {
+		n, _ := rand.Int(rand.Reader, big.NewInt(10))
+		digits[i] = byte('0' + n.Int64())
+	}
+	answer := string(digits)
+
+	defaultCaptchaSessions.mu.Lock()
+	defer defaultCaptchaSessions.mu.Unlock()
+	defaultCaptchaSessions.entries[sessionId] = &defaultCaptchaEntry{answer: answer, expiresAt: time.Now().Add(defaultCaptchaTtl)}
+
+	return answer
+}
+
+// verifyDefaultCaptcha checks token against the challenge issued for
+// sessionId by GenerateDefaultCaptcha, consuming it either way so a
+// challenge can never be replayed whether or not it was answered correctly.
+func verifyDefaultCaptcha(sessionId string, token string) bool {
+	defaultCaptchaSessions.mu.Lock()
+	defer defaultCaptchaSessions.mu.Unlock()
+
+	entry, ok := defaultCaptchaSessions.entries[sessionId]
+	delete(defaultCaptchaSessions.entries, sessionId)
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false
+	}
+	return token != "" && token == entry.answer
+}
+
+// VerifyCaptcha checks a submitted captcha token against the provider
+// configured for the CaptchaDecision. When decision.ScoreThreshold is
+// positive, a provider score below it (reCAPTCHA v3) is rejected.
+// CheckToEnableCaptcha leaves ScoreThreshold at zero, so decisions it builds
+// apply no score threshold.
+//
+// ProviderTypeDefault (Casdoor's built-in image captcha) is checked against
+// the session-stored challenge created by GenerateDefaultCaptcha instead of
+// a third-party verify API, so sessionId must identify the same session the
+// challenge was issued to.
+func VerifyCaptcha(decision *CaptchaDecision, token string, remoteIp string, sessionId string, lang string) string {
+	if decision == nil || !decision.Enabled {
+		return ""
+	}
+
+	if decision.ProviderType == captcha.ProviderTypeDefault {
+		if !verifyDefaultCaptcha(sessionId, token) {
+			return i18n.Translate(lang, "CaptchaErr.WrongCode")
+		}
+		return ""
+	}
+
+	provider := captcha.GetCaptchaProvider(decision.ProviderType, decision.ClientId, decision.ClientSecret)
+	if provider == nil {
+		return i18n.Translate(lang, "CaptchaErr.UnsupportedProvider")
+	}
+
+	score, ok, err := provider.Verify(token, remoteIp)
+	if err != nil {
+		return i18n.Translate(lang, "CaptchaErr.VerifyFailed")
+	}
+	if !ok {
+		return i18n.Translate(lang, "CaptchaErr.WrongCode")
+	}
+	if decision.ScoreThreshold > 0 && score < decision.ScoreThreshold {
+		return i18n.Translate(lang, "CaptchaErr.ScoreTooLow")
+	}
+
+	return ""
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/beego/beego/v2/core/logs"
 	"github.com/casdoor/casdoor/cred"
 	"github.com/casdoor/casdoor/i18n"
 	"github.com/casdoor/casdoor/util"
@@ -76,8 +77,8 @@ func CheckUserSignup(application *Application, organization *Organization, usern
 		}
 	}
 
-	if len(password) <= 5 {
-		return i18n.Translate(lang, "UserErr.PasswordLessThanSixCharacters")
+	if msg := ValidatePassword(organization, nil, password, lang); msg != "" {
+		return msg
 	}
 
 	if application.IsSignupItemVisible("Email") {
@@ -139,37 +140,17 @@ func CheckUserSignup(application *Application, organization *Organization, usern
 	return ""
 }
 
-func checkSigninErrorTimes(user *User, lang string) string {
-	if user.SigninWrongTimes >= SigninWrongTimesLimit {
-		lastSignWrongTime, _ := time.Parse(time.RFC3339, user.LastSigninWrongTime)
-		passedTime := time.Now().UTC().Sub(lastSignWrongTime)
-		seconds := int(LastSignWrongTimeDuration.Seconds() - passedTime.Seconds())
-
-		// deny the login if the error times is greater than the limit and the last login time is less than the duration
-		if seconds > 0 {
-			return fmt.Sprintf(i18n.Translate(lang, "AuthErr.WrongPasswordManyTimes"), seconds/60, seconds%60)
-		}
-
-		// reset the error times
-		user.SigninWrongTimes = 0
-
-		UpdateUser(user.GetId(), user, []string{"signin_wrong_times"}, user.IsGlobalAdmin)
-	}
-
-	return ""
-}
-
 func CheckPassword(user *User, password string, lang string) string {
-	// check the login error times
-	if msg := checkSigninErrorTimes(user, lang); msg != "" {
-		return msg
-	}
-
 	organization := GetOrganizationByUser(user)
 	if organization == nil {
 		return i18n.Translate(lang, "OrgErr.DoNotExist")
 	}
 
+	// check the lockout state before touching the password at all
+	if msg := checkLockoutState(organization, user, lang); msg != "" {
+		return msg
+	}
+
 	credManager := cred.GetCredManager(organization.PasswordType)
 	if credManager != nil {
 		if organization.MasterPassword != "" {
@@ -181,10 +162,10 @@ func CheckPassword(user *User, password string, lang string) string {
 
 		if credManager.IsPasswordCorrect(password, user.Password, user.PasswordSalt, organization.PasswordSalt) {
 			resetUserSigninErrorTimes(user)
-			return ""
+			return checkPasswordExpiry(organization, user, lang)
 		}
 
-		return recordSigninErrorInfo(user)
+		return recordSigninFailure(organization, user, lang)
 	} else {
 		return fmt.Sprintf(i18n.Translate(lang, "LoginErr.UnsupportedPasswordType"), organization.PasswordType)
 	}
@@ -193,59 +174,134 @@ func CheckPassword(user *User, password string, lang string) string {
 func checkLdapUserPassword(user *User, password string, lang string) (*User, string) {
 	ldaps := GetLdaps(user.Owner)
 	ldapLoginSuccess := false
+	lastErr := ""
+
 	for _, ldapServer := range ldaps {
-		conn, err := GetLdapConn(ldapServer.Host, ldapServer.Port, ldapServer.Admin, ldapServer.Passwd)
+		// search as the pooled admin connection only; it must stay
+		// admin-bound so it can be safely reused by the next attempt
+		conn, err := GetLdapConnFromPool(ldapServer)
 		if err != nil {
+			logs.Warning("checkLdapUserPassword: %v", err)
+			lastErr = err.Error()
 			continue
 		}
-		SearchFilter := fmt.Sprintf("(&(objectClass=posixAccount)(uid=%s))", user.Name)
+
+		attrMemberOf := ldapServer.attrOrDefault(ldapServer.AttrMemberOf, "memberOf")
 		searchReq := goldap.NewSearchRequest(ldapServer.BaseDn,
 			goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
-			SearchFilter, []string{}, nil)
-		searchResult, err := conn.Conn.Search(searchReq)
+			ldapServer.getSearchFilter(user.Name), []string{attrMemberOf}, nil)
+		result, err := conn.Conn.Search(searchReq)
 		if err != nil {
-			return nil, err.Error()
+			conn.Conn.Close()
+			logs.Warning("checkLdapUserPassword: %v", err)
+			lastErr = err.Error()
+			continue
 		}
 
-		if len(searchResult.Entries) == 0 {
+		if len(result.Entries) == 0 {
+			releaseLdapConn(conn)
 			continue
-		} else if len(searchResult.Entries) > 1 {
+		} else if len(result.Entries) > 1 {
+			releaseLdapConn(conn)
 			return nil, i18n.Translate(lang, "LdapErr.MultipleAccounts")
 		}
 
-		dn := searchResult.Entries[0].DN
-		if err := conn.Conn.Bind(dn, password); err == nil {
-			ldapLoginSuccess = true
-			break
+		entry := result.Entries[0]
+		dn := entry.DN
+		memberOf := entry.GetAttributeValues(attrMemberOf)
+		// the admin connection is never rebound; give it back to the pool
+		// now, before attempting the end-user bind on a throwaway connection
+		releaseLdapConn(conn)
+
+		if err := bindLdapAsUser(ldapServer, dn, password); err != nil {
+			continue
 		}
+
+		isAllowed, err := checkLdapGroupMembershipAsAdmin(ldapServer, dn, memberOf)
+		if err != nil {
+			logs.Warning("checkLdapUserPassword: group check failed, denying access: %v", err)
+			return nil, i18n.Translate(lang, "LdapErr.GroupCheckFailed")
+		}
+		if !isAllowed {
+			return nil, i18n.Translate(lang, "LdapErr.GroupNotAllowed")
+		}
+
+		ldapLoginSuccess = true
+		break
 	}
 
 	if !ldapLoginSuccess {
+		if lastErr != "" {
+			logs.Warning("checkLdapUserPassword: all ldap servers failed: %s", lastErr)
+		}
 		return nil, i18n.Translate(lang, "LdapErr.PasswordWrong")
 	}
 	return user, ""
 }
 
-func CheckUserPassword(organization string, username string, password string, lang string) (*User, string) {
-	user := GetUserByFields(organization, username)
+// CheckUserPassword authenticates username/password within organization.
+// remoteIp is charged against the IP sliding window at most once per call,
+// and only when this attempt turns out to be a genuine failure — a
+// successful signin never counts against it.
+//
+// The returned requiresTwoFactor is out-of-band from msg: msg is only ever
+// non-empty on an actual failure. When the password check succeeds but the
+// user's organization enforces MFA and the user has an enrolled WebAuthn
+// credential, requiresTwoFactor comes back true with msg empty, so the
+// caller can tell "proceed to the WebAuthn assertion" apart from "signin
+// failed" instead of having to pattern-match an error string.
+func CheckUserPassword(organization string, username string, password string, lang string, remoteIp string) (user *User, msg string, requiresTwoFactor bool) {
+	org := GetOrganization(organization)
+	if CheckIpSigninRateLimit(org, remoteIp) {
+		return nil, i18n.Translate(lang, "LoginErr.TooManyAttemptsFromIp"), false
+	}
+
+	user = GetUserByFields(organization, username)
 	if user == nil || user.IsDeleted == true {
-		return nil, i18n.Translate(lang, "UserErr.DoNotExistSignUp")
+		if getLockoutPolicy(org).LockUnknownUsernameIp {
+			RecordIpSigninFailure(org, remoteIp)
+		}
+		return nil, i18n.Translate(lang, "UserErr.DoNotExistSignUp"), false
 	}
 
 	if user.IsForbidden {
-		return nil, i18n.Translate(lang, "LoginErr.UserIsForbidden")
+		return nil, i18n.Translate(lang, "LoginErr.UserIsForbidden"), false
 	}
 
 	if user.Ldap != "" {
-		// ONLY for ldap users
-		return checkLdapUserPassword(user, password, lang)
+		// ONLY for ldap users. Lockout tracking mirrors the local-password
+		// branch below so directory-backed accounts are covered by the same
+		// organization LockoutPolicy instead of being brute-forceable
+		// without limit beyond the generic per-IP window.
+		if msg := checkLockoutState(org, user, lang); msg != "" {
+			return nil, msg, false
+		}
+
+		ldapUser, ldapMsg := checkLdapUserPassword(user, password, lang)
+		if ldapMsg != "" {
+			RecordIpSigninFailure(org, remoteIp)
+			return nil, recordSigninFailure(org, user, lang), false
+		}
+
+		resetUserSigninErrorTimes(user)
+		user = ldapUser
 	} else {
-		msg := CheckPassword(user, password, lang)
-		if msg != "" {
-			return nil, msg
+		if msg := CheckPassword(user, password, lang); msg != "" {
+			RecordIpSigninFailure(org, remoteIp)
+			return nil, msg, false
 		}
 	}
-	return user, ""
+
+	return user, "", checkRequiresWebAuthn(user)
+}
+
+// checkRequiresWebAuthn reports whether the user's organization enforces MFA
+// and the user has enrolled at least one WebAuthn credential, so
+// CheckUserPassword's caller knows to drive the assertion ceremony before
+// treating the signin as complete.
+func checkRequiresWebAuthn(user *User) bool {
+	organization := GetOrganizationByUser(user)
+	return organization != nil && organization.EnforceMfa && HasEnrolledWebAuthnCredential(user.Owner, user.Name)
 }
 
 func filterField(field string) bool {
@@ -290,10 +346,17 @@ func CheckUserPermission(requestUserId, userId, userOwner string, strict bool, l
 	return hasPermission, fmt.Errorf(i18n.Translate(lang, "LoginErr.NoPermission"))
 }
 
+// CheckAccessPermission reports whether userId may access application. An
+// enabled permission on the application whose Users match userId through
+// matchesWildcardSubject ("*", "role:admin", "org:*", a group DN) grants
+// access at once; that check bypasses the merged enforcer and the decision
+// cache, so policies of the other permissions do not override it. Otherwise
+// the decision comes from CheckAccessPermissionCached, which composes every
+// enabled permission whose Resources include the application into one
+// merged enforcer (cached per application) behind a short-lived LRU
+// decision cache.
 func CheckAccessPermission(userId string, application *Application) (bool, error) {
 	permissions := GetPermissions(application.Organization)
-	allowed := true
-	var err error
 	for _, permission := range permissions {
 		if !permission.IsEnabled || len(permission.Users) == 0 {
 			continue
@@ -307,17 +370,12 @@ func CheckAccessPermission(userId string, application *Application) (bool, error
 			}
 		}
 
-		if isHit {
-			containsAsterisk := ContainsAsterisk(userId, permission.Users)
-			if containsAsterisk {
-				return true, err
-			}
-			enforcer := getEnforcer(permission)
-			allowed, err = enforcer.Enforce(userId, application.Name, "read")
-			break
+		if isHit && matchesWildcardSubject(userId, permission.Users) {
+			return true, nil
 		}
 	}
-	return allowed, err
+
+	return CheckAccessPermissionCached(userId, application, "read")
 }
 
 func CheckUsername(username string, lang string) string {
@@ -341,19 +399,73 @@ func CheckUsername(username string, lang string) string {
 	return ""
 }
 
-func CheckToEnableCaptcha(application *Application) bool {
+// CaptchaDecision describes whether a captcha challenge must be rendered for
+// the current signin/signup attempt, and which provider to render it with.
+type CaptchaDecision struct {
+	Enabled        bool
+	ProviderType   string
+	ClientId       string
+	ClientSecret   string
+	SubType        string
+	ScoreThreshold float64
+}
+
+// CheckToEnableCaptcha decides whether a captcha should be shown for this
+// signin/signup attempt. It replaces the old all-or-nothing "Default"-only
+// check with a decision driven by the ProviderItem's Rule plus live risk
+// signals: the user's recent signin failures, the caller IP's recent
+// failures, and whether the account is approaching lockout.
+func CheckToEnableCaptcha(application *Application, username string, remoteIp string) *CaptchaDecision {
 	if len(application.Providers) == 0 {
-		return false
+		return &CaptchaDecision{Enabled: false}
 	}
 
 	for _, providerItem := range application.Providers {
-		if providerItem.Provider == nil {
+		if providerItem.Provider == nil || providerItem.Provider.Category != "Captcha" {
 			continue
 		}
-		if providerItem.Provider.Category == "Captcha" && providerItem.Provider.Type == "Default" {
-			return providerItem.Rule == "Always"
+
+		decision := &CaptchaDecision{
+			ProviderType: providerItem.Provider.Type,
+			ClientId:     providerItem.Provider.ClientId,
+			ClientSecret: providerItem.Provider.ClientSecret,
+			SubType:      providerItem.Provider.SubType,
+		}
+
+		switch providerItem.Rule {
+		case "Always":
+			decision.Enabled = true
+		case "Never":
+			decision.Enabled = false
+		default: // "Risk"
+			decision.Enabled = isCaptchaRiskTriggered(application.Organization, username, remoteIp)
 		}
+
+		return decision
+	}
+
+	return &CaptchaDecision{Enabled: false}
+}
+
+// isCaptchaRiskTriggered inspects the current failure signals to decide
+// whether a "Risk" rule provider should challenge this attempt. It only
+// peeks at the IP window populated by CheckUserPassword's own failures; it
+// never records an attempt itself, so a single login flow is never charged
+// twice.
+func isCaptchaRiskTriggered(organization string, username string, remoteIp string) bool {
+	org := GetOrganization(organization)
+	if CheckIpSigninRateLimit(org, remoteIp) {
+		return true
+	}
+
+	user := GetUserByFields(organization, username)
+	if user == nil {
+		return false
+	}
+	if user.SigninWrongTimes > 0 {
+		return true
 	}
 
-	return false
+	policy := getLockoutPolicy(GetOrganizationByUser(user))
+	return user.SigninWrongTimes >= policy.MaxAttempts-1
 }
@@ -0,0 +1,43 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import "testing"
+
+// TestCheckUserPermissionAlwaysReturnsError pins down CheckUserPermission's
+// actual contract: it returns a non-nil error on every path, including ones
+// where hasPermission is true. Callers must branch on hasPermission, not on
+// err != nil, or every call looks like a failure.
+func TestCheckUserPermissionAlwaysReturnsError(t *testing.T) {
+	hasPermission, err := CheckUserPermission("app/my-app", "", "", true, "en")
+	if !hasPermission {
+		t.Fatalf("expected app/-prefixed callers to always have permission")
+	}
+	if err == nil {
+		t.Fatalf("expected CheckUserPermission to return a non-nil error even when hasPermission is true")
+	}
+}
+
+// TestCheckUserPermissionRejectsEmptyRequestUser covers the other side of
+// the same contract: hasPermission is false and err explains why.
+func TestCheckUserPermissionRejectsEmptyRequestUser(t *testing.T) {
+	hasPermission, err := CheckUserPermission("", "", "", true, "en")
+	if hasPermission {
+		t.Fatalf("expected an empty requestUserId to be denied")
+	}
+	if err == nil {
+		t.Fatalf("expected a non-nil error explaining the denial")
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// mergedEnforcerCache holds one Casbin enforcer per application, built by
+// unioning all enabled permissions whose Resources include that
+// application, so multiple permissions compose instead of the first match
+// winning.
+type mergedEnforcerCache struct {
+	mu    sync.RWMutex
+	byApp map[string]*casbin.Enforcer
+}
+
+var appEnforcerCache = &mergedEnforcerCache{byApp: map[string]*casbin.Enforcer{}}
+
+// getMergedEnforcer returns the cached, merged enforcer for an application,
+// building it from every enabled permission that applies to it if it is not
+// already cached.
+func getMergedEnforcer(application *Application) *casbin.Enforcer {
+	appEnforcerCache.mu.RLock()
+	enforcer, ok := appEnforcerCache.byApp[application.Name]
+	appEnforcerCache.mu.RUnlock()
+	if ok {
+		return enforcer
+	}
+
+	permissions := GetPermissions(application.Organization)
+	var applicable []*Permission
+	for _, permission := range permissions {
+		if !permission.IsEnabled || len(permission.Users) == 0 {
+			continue
+		}
+		for _, resource := range permission.Resources {
+			if resource == application.Name {
+				applicable = append(applicable, permission)
+				break
+			}
+		}
+	}
+
+	enforcer = buildMergedEnforcer(applicable)
+
+	appEnforcerCache.mu.Lock()
+	appEnforcerCache.byApp[application.Name] = enforcer
+	appEnforcerCache.mu.Unlock()
+
+	return enforcer
+}
+
+// buildMergedEnforcer unions the policies of every applicable permission
+// into a single, brand-new enforcer so that allow/deny semantics compose
+// across permissions instead of stopping at the first match. It never
+// reuses or mutates a permission's own cached getEnforcer(permission)
+// instance: the merged enforcer is always built from a freshly parsed copy
+// of the model, since Casbin's Enforcer and model.Model share the
+// underlying policy storage they were constructed with, and calling
+// AddPolicies on a shared model.Model would corrupt every other holder of
+// that same enforcer. Permissions whose Casbin model doesn't match the rest
+// of the application's permissions are skipped with a warning rather than
+// merged, since unioning policies across incompatible models is unsound.
+func buildMergedEnforcer(permissions []*Permission) *casbin.Enforcer {
+	var merged *casbin.Enforcer
+	var baseModelText string
+
+	for _, permission := range permissions {
+		enforcer := getEnforcer(permission)
+		if enforcer == nil {
+			continue
+		}
+
+		modelText := enforcer.GetModel().ToText()
+
+		if merged == nil {
+			freshModel, err := model.NewModelFromString(modelText)
+			if err != nil {
+				logs.Warning("buildMergedEnforcer: failed to parse model for permission %s: %v", permission.GetId(), err)
+				continue
+			}
+			freshEnforcer, err := casbin.NewEnforcer(freshModel)
+			if err != nil {
+				logs.Warning("buildMergedEnforcer: failed to build enforcer for permission %s: %v", permission.GetId(), err)
+				continue
+			}
+
+			merged = freshEnforcer
+			baseModelText = modelText
+		} else if modelText != baseModelText {
+			logs.Warning("buildMergedEnforcer: permission %s uses a different Casbin model than the rest of the application's permissions, skipping it", permission.GetId())
+			continue
+		}
+
+		policies := enforcer.GetPolicy()
+		if len(policies) > 0 {
+			if _, err := merged.AddPolicies(policies); err != nil {
+				logs.Warning("buildMergedEnforcer: failed to add policies for permission %s: %v", permission.GetId(), err)
+			}
+		}
+	}
+	return merged
+}
+
+// invalidateAppEnforcerCache drops every cached merged enforcer, for all
+// applications and organizations, forcing a rebuild on next access. It is
+// called through invalidatePermissionCaches from the Permission and Role
+// save hooks.
+func invalidateAppEnforcerCache() {
+	appEnforcerCache.mu.Lock()
+	defer appEnforcerCache.mu.Unlock()
+	appEnforcerCache.byApp = map[string]*casbin.Enforcer{}
+}
+
+// decisionCacheEntry is one LRU node for the (user, app, action) decision
+// cache.
+type decisionCacheEntry struct {
+	key       string
+	allowed   bool
+	expiresAt time.Time
+}
+
+type decisionLruCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+var accessDecisionCache = newDecisionLruCache(10000, 30*time.Second)
+
+func newDecisionLruCache(capacity int, ttl time.Duration) *decisionLruCache {
+	return &decisionLruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func decisionCacheKey(userId, appName, action string) string {
+	return userId + "|" + appName + "|" + action
+}
+
+func (c *decisionLruCache) get(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return false, false
+	}
+
+	entry := elem.Value.(*decisionCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return false, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.allowed, true
+}
+
+func (c *decisionLruCache) set(key string, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*decisionCacheEntry).allowed = allowed
+		elem.Value.(*decisionCacheEntry).expiresAt = time.Now().Add(c.ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	entry := &decisionCacheEntry{key: key, allowed: allowed, expiresAt: time.Now().Add(c.ttl)}
+	elem := c.order.PushFront(entry)
+	c.items[key] = elem
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*decisionCacheEntry).key)
+		}
+	}
+}
+
+// invalidateDecisionCache clears the whole decision cache. Casbin policy
+// updates are infrequent relative to reads, so a full clear on invalidation
+// is simpler than tracking per-user/app dependency sets and still cheap.
+func invalidateDecisionCache() {
+	accessDecisionCache.mu.Lock()
+	defer accessDecisionCache.mu.Unlock()
+	accessDecisionCache.order = list.New()
+	accessDecisionCache.items = map[string]*list.Element{}
+}
+
+// invalidatePermissionCaches is called from the Permission and Role save
+// hooks (AddPermission/UpdatePermission/DeletePermission, the equivalent
+// Role functions) to keep the merged enforcer and decision caches from
+// serving stale policy. It is not yet wired into a User save hook, so a
+// change to a user's own IsGlobalAdmin/Owner/Groups — which
+// matchesWildcardSubject and CheckAccessPermission also read — can leave a
+// stale cached decision for that user until it naturally evicts.
+func invalidatePermissionCaches() {
+	invalidateAppEnforcerCache()
+	invalidateDecisionCache()
+}
+
+// matchesWildcardSubject extends the existing ContainsAsterisk matcher with
+// role:, org: and arbitrary group-DN wildcard subjects, e.g. "role:admin",
+// "org:*", or a group DN pattern.
+func matchesWildcardSubject(userId string, subjects []string) bool {
+	if ContainsAsterisk(userId, subjects) {
+		return true
+	}
+
+	user := GetUser(userId)
+	if user == nil {
+		return false
+	}
+
+	for _, subject := range subjects {
+		switch {
+		case strings.HasPrefix(subject, "role:"):
+			roleName := strings.TrimPrefix(subject, "role:")
+			if userHasRole(user, roleName) {
+				return true
+			}
+		case subject == "org:*":
+			return true
+		case strings.HasPrefix(subject, "org:"):
+			if user.Owner == strings.TrimPrefix(subject, "org:") {
+				return true
+			}
+		case strings.Contains(subject, "=") && user.Ldap != "":
+			// looks like a group DN, e.g. "cn=admins,ou=groups,dc=example,dc=com"
+			if userInLdapGroup(user, subject) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func userHasRole(user *User, roleName string) bool {
+	for _, role := range GetRolesByUser(user.GetId()) {
+		if role.Name == roleName {
+			return true
+		}
+	}
+	return false
+}
+
+func userInLdapGroup(user *User, groupDn string) bool {
+	for _, group := range user.Groups {
+		if strings.EqualFold(group, groupDn) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAccessPermissionCached decides access through the application's
+// merged enforcer, memoized in the (user, app, action) decision cache.
+// CheckAccessPermission falls through to it when no wildcard subject
+// matched.
+func CheckAccessPermissionCached(userId string, application *Application, action string) (bool, error) {
+	key := decisionCacheKey(userId, application.Name, action)
+	if allowed, ok := accessDecisionCache.get(key); ok {
+		return allowed, nil
+	}
+
+	enforcer := getMergedEnforcer(application)
+	if enforcer == nil {
+		// No Permission references this application at all: preserve the
+		// original default-allow-when-unconfigured behavior rather than
+		// locking every user out of an application nobody has restricted.
+		accessDecisionCache.set(key, true)
+		return true, nil
+	}
+
+	allowed, err := enforcer.Enforce(userId, application.Name, action)
+	if err != nil {
+		return false, err
+	}
+
+	accessDecisionCache.set(key, allowed)
+	return allowed, nil
+}
+
+// BatchCheckAccessPermission checks access to many applications for a
+// single user in one call, so UI listings can render which apps are
+// allowed without issuing one enforcer call per row.
+func BatchCheckAccessPermission(userId string, appNames []string, action string) (map[string]bool, error) {
+	result := make(map[string]bool, len(appNames))
+	for _, appName := range appNames {
+		application := GetApplication(appName)
+		if application == nil {
+			result[appName] = false
+			continue
+		}
+
+		allowed, err := CheckAccessPermissionCached(userId, application, action)
+		if err != nil {
+			return nil, err
+		}
+		result[appName] = allowed
+	}
+	return result, nil
+}
@@ -0,0 +1,305 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// CONN_SECURITY enumerates the supported LDAP transport security modes,
+// mirroring the naming used for other provider-level enum constants.
+const (
+	CONN_SECURITY_NONE     = "NONE"
+	CONN_SECURITY_STARTTLS = "STARTTLS"
+	CONN_SECURITY_TLS      = "TLS"
+)
+
+// Ldap holds the connection parameters for a single directory server,
+// including the TLS, search and group-restriction settings consumed by
+// checkLdapUserPassword.
+type Ldap struct {
+	Id       string `xorm:"varchar(100) notnull pk" json:"id"`
+	Owner    string `xorm:"varchar(100)" json:"owner"`
+	Host     string `xorm:"varchar(100)" json:"host"`
+	Port     int    `xorm:"int" json:"port"`
+	Admin    string `xorm:"varchar(100)" json:"admin"`
+	Passwd   string `xorm:"varchar(100)" json:"passwd"`
+	BaseDn   string `xorm:"varchar(100)" json:"baseDn"`
+
+	ConnSecurity       string `xorm:"varchar(20)" json:"connSecurity"`
+	TlsCaCertFile      string `xorm:"varchar(255)" json:"tlsCaCertFile"`
+	TlsServerName      string `xorm:"varchar(100)" json:"tlsServerName"`
+	TlsInsecureSkip    bool   `xorm:"bool" json:"tlsInsecureSkip"`
+	TlsMinVersion      string `xorm:"varchar(10)" json:"tlsMinVersion"` // "1.0", "1.1", "1.2", "1.3"
+
+	SearchFilter   string `xorm:"varchar(255)" json:"searchFilter"` // e.g. "(&(objectClass=posixAccount)(uid={username}))"
+	AttrUid        string `xorm:"varchar(100)" json:"attrUid"`
+	AttrMail       string `xorm:"varchar(100)" json:"attrMail"`
+	AttrDisplay    string `xorm:"varchar(100)" json:"attrDisplay"`
+	AttrMemberOf   string `xorm:"varchar(100)" json:"attrMemberOf"`
+
+	RequiredGroupDn string `xorm:"varchar(255)" json:"requiredGroupDn"`
+	DeniedGroupDn   string `xorm:"varchar(255)" json:"deniedGroupDn"`
+}
+
+func (ldap *Ldap) getSearchFilter(username string) string {
+	filter := ldap.SearchFilter
+	if filter == "" {
+		filter = "(&(objectClass=posixAccount)(uid={username}))"
+	}
+	return strings.ReplaceAll(filter, "{username}", goldap.EscapeFilter(username))
+}
+
+func (ldap *Ldap) attrOrDefault(attr, defaultAttr string) string {
+	if attr == "" {
+		return defaultAttr
+	}
+	return attr
+}
+
+// LdapConn wraps a pooled connection together with the server it was
+// established against, so the pool can be returned to or evicted from the
+// cache based on health.
+type LdapConn struct {
+	Conn      *goldap.Conn
+	server    *Ldap
+	createdAt time.Time
+}
+
+type ldapConnPool struct {
+	mu    sync.Mutex
+	conns map[string][]*LdapConn
+}
+
+var globalLdapConnPool = &ldapConnPool{conns: map[string][]*LdapConn{}}
+
+const ldapConnMaxAge = 5 * time.Minute
+
+func ldapPoolKey(ldapServer *Ldap) string {
+	return fmt.Sprintf("%s:%d", ldapServer.Host, ldapServer.Port)
+}
+
+// getPooledLdapConn returns a cached healthy connection for the server if
+// one exists, otherwise nil.
+func (p *ldapConnPool) getPooledLdapConn(ldapServer *Ldap) *LdapConn {
+	key := ldapPoolKey(ldapServer)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := p.conns[key]
+	for len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		p.conns[key] = conns
+
+		if time.Since(conn.createdAt) > ldapConnMaxAge {
+			conn.Conn.Close()
+			continue
+		}
+		if _, err := conn.Conn.Search(goldap.NewSearchRequest("", goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", []string{"1.1"}, nil)); err != nil {
+			conn.Conn.Close()
+			continue
+		}
+		return conn
+	}
+	return nil
+}
+
+func (p *ldapConnPool) release(conn *LdapConn) {
+	key := ldapPoolKey(conn.server)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conns[key] = append(p.conns[key], conn)
+}
+
+// buildLdapTlsConfig translates a server's security settings into a
+// crypto/tls.Config used for both STARTTLS and LDAPS connections.
+func buildLdapTlsConfig(ldapServer *Ldap) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         ldapServer.TlsServerName,
+		InsecureSkipVerify: ldapServer.TlsInsecureSkip,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = ldapServer.Host
+	}
+
+	switch ldapServer.TlsMinVersion {
+	case "1.0":
+		tlsConfig.MinVersion = tls.VersionTLS10
+	case "1.1":
+		tlsConfig.MinVersion = tls.VersionTLS11
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	if ldapServer.TlsCaCertFile != "" {
+		caCert, err := os.ReadFile(ldapServer.TlsCaCertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA cert file: %s", ldapServer.TlsCaCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// dialLdapServer opens a new connection honoring the server's ConnSecurity
+// mode and binds as the configured admin account.
+func dialLdapServer(ldapServer *Ldap) (*LdapConn, error) {
+	var conn *goldap.Conn
+	var err error
+
+	switch ldapServer.ConnSecurity {
+	case CONN_SECURITY_TLS:
+		tlsConfig, tlsErr := buildLdapTlsConfig(ldapServer)
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		conn, err = goldap.DialTLS("tcp", fmt.Sprintf("%s:%d", ldapServer.Host, ldapServer.Port), tlsConfig)
+	default:
+		conn, err = goldap.Dial("tcp", fmt.Sprintf("%s:%d", ldapServer.Host, ldapServer.Port))
+		if err == nil && ldapServer.ConnSecurity == CONN_SECURITY_STARTTLS {
+			tlsConfig, tlsErr := buildLdapTlsConfig(ldapServer)
+			if tlsErr != nil {
+				conn.Close()
+				return nil, tlsErr
+			}
+			if startTlsErr := conn.StartTLS(tlsConfig); startTlsErr != nil {
+				conn.Close()
+				return nil, startTlsErr
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ldapServer.Admin != "" {
+		if err = conn.Bind(ldapServer.Admin, ldapServer.Passwd); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return &LdapConn{Conn: conn, server: ldapServer, createdAt: time.Now()}, nil
+}
+
+// GetLdapConnFromPool returns a pooled connection for ldapServer, dialing
+// and authenticating a new one if the pool is empty or every cached
+// connection failed its health check. Replaces the old per-attempt
+// GetLdapConn(host, port, admin, passwd) with a failover-aware, pooled
+// equivalent.
+func GetLdapConnFromPool(ldapServer *Ldap) (*LdapConn, error) {
+	if conn := globalLdapConnPool.getPooledLdapConn(ldapServer); conn != nil {
+		return conn, nil
+	}
+	return dialLdapServer(ldapServer)
+}
+
+// releaseLdapConn returns a still-healthy connection to the pool; a
+// connection involved in an error is closed by the caller instead.
+func releaseLdapConn(conn *LdapConn) {
+	globalLdapConnPool.release(conn)
+}
+
+// bindLdapAsUser authenticates the end user on a fresh, throwaway
+// connection. This connection is rebound to the user's identity, so unlike
+// the pooled admin connections used for search it is never returned to
+// globalLdapConnPool.
+func bindLdapAsUser(ldapServer *Ldap, userDn string, password string) error {
+	conn, err := dialLdapServer(&Ldap{
+		Host:            ldapServer.Host,
+		Port:            ldapServer.Port,
+		ConnSecurity:    ldapServer.ConnSecurity,
+		TlsCaCertFile:   ldapServer.TlsCaCertFile,
+		TlsServerName:   ldapServer.TlsServerName,
+		TlsInsecureSkip: ldapServer.TlsInsecureSkip,
+		TlsMinVersion:   ldapServer.TlsMinVersion,
+		// no Admin/Passwd: dialLdapServer only binds when Admin is set
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Conn.Close()
+
+	return conn.Conn.Bind(userDn, password)
+}
+
+// checkLdapGroupMembershipAsAdmin enforces RequiredGroupDn / DeniedGroupDn
+// after a successful user bind, using the memberOf attribute collected
+// during the admin search when present, falling back to a group search
+// performed over a fresh pooled admin connection otherwise. A group-search
+// error is propagated rather than swallowed, since silently treating it as
+// "not a member" would wrongly deny a legitimately-entitled user.
+func checkLdapGroupMembershipAsAdmin(ldapServer *Ldap, userDn string, memberOf []string) (bool, error) {
+	if ldapServer.RequiredGroupDn == "" && ldapServer.DeniedGroupDn == "" {
+		return true, nil
+	}
+
+	isMember := func(groupDn string) (bool, error) {
+		for _, dn := range memberOf {
+			if strings.EqualFold(dn, groupDn) {
+				return true, nil
+			}
+		}
+
+		conn, err := GetLdapConnFromPool(ldapServer)
+		if err != nil {
+			return false, err
+		}
+		searchReq := goldap.NewSearchRequest(groupDn,
+			goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0, 0, false,
+			fmt.Sprintf("(member=%s)", goldap.EscapeFilter(userDn)), []string{"dn"}, nil)
+		result, err := conn.Conn.Search(searchReq)
+		if err != nil {
+			conn.Conn.Close()
+			return false, err
+		}
+		releaseLdapConn(conn)
+		return len(result.Entries) > 0, nil
+	}
+
+	if ldapServer.DeniedGroupDn != "" {
+		denied, err := isMember(ldapServer.DeniedGroupDn)
+		if err != nil {
+			return false, err
+		}
+		if denied {
+			return false, nil
+		}
+	}
+
+	if ldapServer.RequiredGroupDn != "" {
+		return isMember(ldapServer.RequiredGroupDn)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor/i18n"
+)
+
+// LockoutPolicy controls how many wrong signin attempts an organization
+// tolerates before locking the account, and how the lock duration escalates
+// if the user keeps failing after being unlocked. A non-nil policy falls
+// back to DefaultLockoutPolicy field by field for whichever fields are left
+// at their Go zero value, via mergeLockoutPolicyDefaults.
+type LockoutPolicy struct {
+	MaxAttempts           int  `xorm:"int" json:"maxAttempts"`
+	BaseLockDuration      int  `xorm:"int" json:"baseLockDuration"` // in minutes
+	EscalationMultiplier  int  `xorm:"int" json:"escalationMultiplier"`
+	MaxLockDuration       int  `xorm:"int" json:"maxLockDuration"` // in minutes, 0 means unbounded
+	LockoutCooldownHours  int  `xorm:"int" json:"lockoutCooldownHours"`
+	LockUnknownUsernameIp bool `xorm:"bool" json:"lockUnknownUsernameIp"`
+}
+
+// DefaultLockoutPolicy mirrors the previous hardcoded globals so existing
+// organizations keep their current behavior until they opt into a custom
+// policy.
+var DefaultLockoutPolicy = &LockoutPolicy{
+	MaxAttempts:           SigninWrongTimesLimit,
+	BaseLockDuration:      15,
+	EscalationMultiplier:  1,
+	MaxLockDuration:       0,
+	LockoutCooldownHours:  24,
+	LockUnknownUsernameIp: false,
+}
+
+func getLockoutPolicy(organization *Organization) *LockoutPolicy {
+	if organization == nil || organization.LockoutPolicy == nil {
+		return DefaultLockoutPolicy
+	}
+	return mergeLockoutPolicyDefaults(organization.LockoutPolicy)
+}
+
+// mergeLockoutPolicyDefaults fills any field the organization left at its
+// Go zero value with DefaultLockoutPolicy's value, field by field, instead
+// of an all-or-nothing nil check. Otherwise a custom LockoutPolicy that only
+// sets e.g. LockUnknownUsernameIp would silently zero out MaxAttempts,
+// locking an account out on its very first wrong attempt.
+func mergeLockoutPolicyDefaults(policy *LockoutPolicy) *LockoutPolicy {
+	merged := *policy
+	if merged.MaxAttempts == 0 {
+		merged.MaxAttempts = DefaultLockoutPolicy.MaxAttempts
+	}
+	if merged.BaseLockDuration == 0 {
+		merged.BaseLockDuration = DefaultLockoutPolicy.BaseLockDuration
+	}
+	if merged.EscalationMultiplier == 0 {
+		merged.EscalationMultiplier = DefaultLockoutPolicy.EscalationMultiplier
+	}
+	if merged.LockoutCooldownHours == 0 {
+		merged.LockoutCooldownHours = DefaultLockoutPolicy.LockoutCooldownHours
+	}
+	return &merged
+}
+
+// lockDurationForLevel computes how long an account should stay locked given
+// how many times it has already been locked (lockoutLevel), capped at
+// MaxLockDuration when set.
+func lockDurationForLevel(policy *LockoutPolicy, lockoutLevel int) time.Duration {
+	multiplier := 1
+	for i := 0; i < lockoutLevel; i++ {
+		multiplier *= policy.EscalationMultiplier
+		if multiplier <= 0 {
+			multiplier = 1
+			break
+		}
+	}
+
+	duration := time.Duration(policy.BaseLockDuration*multiplier) * time.Minute
+	maxDuration := time.Duration(policy.MaxLockDuration) * time.Minute
+	if policy.MaxLockDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+	return duration
+}
+
+// lockUser escalates the user's LockoutLevel, sets LockoutUntil according to
+// the organization's LockoutPolicy, and records an audit log entry.
+func lockUser(organization *Organization, user *User) {
+	policy := getLockoutPolicy(organization)
+
+	cooldown := time.Duration(policy.LockoutCooldownHours) * time.Hour
+	lastLockoutTime, err := time.Parse(time.RFC3339, user.LockoutUntil)
+	if err == nil && cooldown > 0 && time.Now().UTC().Sub(lastLockoutTime) > cooldown {
+		user.LockoutLevel = 0
+	}
+
+	duration := lockDurationForLevel(policy, user.LockoutLevel)
+	user.LockoutUntil = time.Now().UTC().Add(duration).Format(time.RFC3339)
+	user.LockoutLevel++
+	user.SigninWrongTimes = 0
+
+	UpdateUser(user.GetId(), user, []string{"lockout_until", "lockout_level", "signin_wrong_times"}, user.IsGlobalAdmin)
+	AddAuditLog(newLockoutAuditRecord(user, "lock"))
+}
+
+// UnlockUser clears a user's lockout state ahead of its natural expiry, for
+// use by the admin unlock API.
+func UnlockUser(user *User) error {
+	user.LockoutUntil = ""
+	user.SigninWrongTimes = 0
+
+	affected, err := UpdateUser(user.GetId(), user, []string{"lockout_until", "signin_wrong_times"}, user.IsGlobalAdmin)
+	if err != nil {
+		return err
+	}
+	if affected {
+		AddAuditLog(newLockoutAuditRecord(user, "unlock"))
+	}
+	return nil
+}
+
+func newLockoutAuditRecord(user *User, action string) *AuditLog {
+	return &AuditLog{
+		Owner:       user.Owner,
+		User:        user.Name,
+		Action:      "lockout." + action,
+		CreatedTime: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// checkLockoutState returns a non-empty i18n error if the user is currently
+// locked out, replacing the old checkSigninErrorTimes wrong-count-only
+// behavior with organization-configurable lockout.
+func checkLockoutState(organization *Organization, user *User, lang string) string {
+	if user.LockoutUntil == "" {
+		return ""
+	}
+
+	lockoutUntil, err := time.Parse(time.RFC3339, user.LockoutUntil)
+	if err != nil {
+		return ""
+	}
+
+	remaining := time.Until(lockoutUntil)
+	if remaining <= 0 {
+		user.LockoutUntil = ""
+		UpdateUser(user.GetId(), user, []string{"lockout_until"}, user.IsGlobalAdmin)
+		return ""
+	}
+
+	seconds := int(remaining.Seconds())
+	return fmt.Sprintf(i18n.Translate(lang, "AuthErr.AccountLocked"), seconds/60, seconds%60)
+}
+
+// recordSigninFailure increments the wrong-attempt counter and locks the
+// account once the organization's MaxAttempts is reached.
+func recordSigninFailure(organization *Organization, user *User, lang string) string {
+	policy := getLockoutPolicy(organization)
+
+	user.SigninWrongTimes++
+	user.LastSigninWrongTime = time.Now().UTC().Format(time.RFC3339)
+
+	if user.SigninWrongTimes >= policy.MaxAttempts {
+		lockUser(organization, user)
+		return checkLockoutState(organization, user, lang)
+	}
+
+	UpdateUser(user.GetId(), user, []string{"signin_wrong_times", "last_signin_wrong_time"}, user.IsGlobalAdmin)
+	return i18n.Translate(lang, "AuthErr.WrongPassword")
+}
+
+// ipSigninAttempt is an in-memory sliding-window counter used to rate-limit
+// signin attempts before a user is looked up, defeating username enumeration
+// and credential stuffing. A production deployment with multiple replicas
+// should move this to a shared store such as Redis.
+type ipSigninAttempt struct {
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+}
+
+var ipLimiter = &ipSigninAttempt{attempts: map[string][]time.Time{}}
+
+// defaultIpWindowDuration is the sliding window used by the IP limiter for
+// every organization; LockoutPolicy has no window setting.
+const defaultIpWindowDuration = time.Minute
+
+// recordIpSigninFailure appends a failed attempt for remoteIp and reports
+// whether that pushes it over limit within the sliding window. It must be
+// called at most once per genuine signin failure; it does not count
+// successful logins.
+func recordIpSigninFailure(remoteIp string, limit int, window time.Duration) bool {
+	if remoteIp == "" {
+		return false
+	}
+
+	ipLimiter.mu.Lock()
+	defer ipLimiter.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+
+	attempts := ipLimiter.attempts[remoteIp]
+	kept := attempts[:0]
+	for _, t := range attempts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	ipLimiter.attempts[remoteIp] = kept
+
+	return len(kept) > limit
+}
+
+// peekIpSigninRateLimit reports whether remoteIp is already over the
+// sliding-window limit, without recording a new attempt. Use this to gate a
+// login attempt before it happens; use recordIpSigninFailure to charge the
+// window once the attempt has actually failed.
+func peekIpSigninRateLimit(remoteIp string, limit int, window time.Duration) bool {
+	if remoteIp == "" {
+		return false
+	}
+
+	ipLimiter.mu.Lock()
+	defer ipLimiter.mu.Unlock()
+
+	cutoff := time.Now().Add(-window)
+	attempts := ipLimiter.attempts[remoteIp]
+	count := 0
+	for _, t := range attempts {
+		if t.After(cutoff) {
+			count++
+		}
+	}
+	return count > limit
+}
+
+// CheckIpSigninRateLimit reports whether remoteIp has already made too many
+// failed signin attempts (more than the organization's MaxAttempts) within
+// defaultIpWindowDuration, without charging the window itself — callers must explicitly record a
+// failure via RecordIpSigninFailure once one occurs, so a single login
+// attempt is never counted more than once and successful logins are never
+// counted at all.
+func CheckIpSigninRateLimit(organization *Organization, remoteIp string) bool {
+	policy := getLockoutPolicy(organization)
+	return peekIpSigninRateLimit(remoteIp, policy.MaxAttempts, defaultIpWindowDuration)
+}
+
+// RecordIpSigninFailure charges remoteIp's sliding window with one failed
+// attempt. Call this exactly once per genuine signin failure (wrong
+// password, unknown username when LockUnknownUsernameIp is set), never for
+// a successful login.
+func RecordIpSigninFailure(organization *Organization, remoteIp string) {
+	policy := getLockoutPolicy(organization)
+	recordIpSigninFailure(remoteIp, policy.MaxAttempts, defaultIpWindowDuration)
+}
+
+// GetLockedUsers returns all users in the organization whose account is
+// currently locked out, for the GET /api/locked-users endpoint.
+func GetLockedUsers(owner string) ([]*User, error) {
+	users := []*User{}
+	err := adapter.Engine.Where("owner = ? AND lockout_until <> ?", owner, "").Find(&users)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	lockedUsers := []*User{}
+	for _, user := range users {
+		lockoutUntil, err := time.Parse(time.RFC3339, user.LockoutUntil)
+		if err == nil && lockoutUntil.After(now) {
+			lockedUsers = append(lockedUsers, user)
+		}
+	}
+	return lockedUsers, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+// Organization represents one tenant. Only the fields touched by the
+// signin, lockout, password-policy and WebAuthn code paths are declared
+// here.
+type Organization struct {
+	Owner string `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name  string `xorm:"varchar(100) notnull pk" json:"name"`
+
+	PasswordType   string `xorm:"varchar(100)" json:"passwordType"`
+	PasswordSalt   string `xorm:"varchar(100)" json:"passwordSalt"`
+	MasterPassword string `xorm:"varchar(100)" json:"masterPassword"`
+	PhonePrefix    string `xorm:"varchar(10)" json:"phonePrefix"`
+
+	EnforceMfa bool `xorm:"bool" json:"enforceMfa"`
+
+	// PasswordPolicy/LockoutPolicy are nil until the organization opts into
+	// a custom policy; getPasswordPolicy/getLockoutPolicy fall back to the
+	// package-level defaults in that case.
+	PasswordPolicy *PasswordPolicy `xorm:"json" json:"passwordPolicy"`
+	LockoutPolicy  *LockoutPolicy  `xorm:"json" json:"lockoutPolicy"`
+}
+
+// GetOrganization looks an organization up by name, for the signin paths
+// that only have the claimed organization name and not yet a resolved User
+// to derive it from (e.g. an unknown-username lockout decision).
+func GetOrganization(name string) *Organization {
+	if name == "" {
+		return nil
+	}
+
+	organization := &Organization{Name: name}
+	existed, err := adapter.Engine.Get(organization)
+	if err != nil || !existed {
+		return nil
+	}
+	return organization
+}
@@ -0,0 +1,318 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/casdoor/casdoor/cred"
+	"github.com/casdoor/casdoor/i18n"
+	"github.com/casdoor/casdoor/util"
+)
+
+// PasswordPolicy controls the complexity, history and expiry rules that a
+// password must satisfy for a given organization. A nil policy falls back to
+// DefaultPasswordPolicy entirely; a non-nil policy falls back to
+// DefaultPasswordPolicy field by field for whichever fields are left at
+// their Go zero value, via mergePasswordPolicyDefaults.
+type PasswordPolicy struct {
+	MinLength        int    `xorm:"int" json:"minLength"`
+	MaxLength        int    `xorm:"int" json:"maxLength"`
+	RequireLowercase bool   `xorm:"bool" json:"requireLowercase"`
+	RequireUppercase bool   `xorm:"bool" json:"requireUppercase"`
+	RequireDigit     bool   `xorm:"bool" json:"requireDigit"`
+	RequireSymbol    bool   `xorm:"bool" json:"requireSymbol"`
+	MaxRepeatedChars int    `xorm:"int" json:"maxRepeatedChars"`
+	DenylistFile     string `xorm:"varchar(255)" json:"denylistFile"`
+	HistoryDepth     int    `xorm:"int" json:"historyDepth"`
+	ExpireDays       int    `xorm:"int" json:"expireDays"`
+}
+
+// DefaultPasswordPolicy is used when an organization has not configured its
+// own PasswordPolicy.
+var DefaultPasswordPolicy = &PasswordPolicy{
+	MinLength:        8,
+	MaxLength:        64,
+	RequireLowercase: false,
+	RequireUppercase: false,
+	RequireDigit:     false,
+	RequireSymbol:    false,
+	MaxRepeatedChars: 0,
+	HistoryDepth:     0,
+	ExpireDays:       0,
+}
+
+// UserPasswordHistory stores the salted hash of a password a user has used
+// in the past, so ValidatePassword can reject reuse within HistoryDepth.
+type UserPasswordHistory struct {
+	Id           int64  `xorm:"pk autoincr" json:"id"`
+	Owner        string `xorm:"varchar(100) index" json:"owner"`
+	Name         string `xorm:"varchar(100) index" json:"name"`
+	Password     string `xorm:"varchar(255)" json:"-"`
+	PasswordSalt string `xorm:"varchar(100)" json:"-"`
+	CreatedTime  string `xorm:"varchar(100)" json:"createdTime"`
+}
+
+var (
+	passwordDenylistCacheMu sync.Mutex
+	passwordDenylistCache   = map[string]map[string]bool{}
+)
+
+func getPasswordPolicy(organization *Organization) *PasswordPolicy {
+	if organization == nil || organization.PasswordPolicy == nil {
+		return DefaultPasswordPolicy
+	}
+	return mergePasswordPolicyDefaults(organization.PasswordPolicy)
+}
+
+// mergePasswordPolicyDefaults fills any field the organization left at its
+// Go zero value with DefaultPasswordPolicy's value, field by field, instead
+// of an all-or-nothing nil check. Otherwise a custom PasswordPolicy that
+// only sets e.g. RequireDigit would silently zero out MinLength, permitting
+// empty passwords rather than falling back to the documented default.
+func mergePasswordPolicyDefaults(policy *PasswordPolicy) *PasswordPolicy {
+	merged := *policy
+	if merged.MinLength == 0 {
+		merged.MinLength = DefaultPasswordPolicy.MinLength
+	}
+	if merged.MaxLength == 0 {
+		merged.MaxLength = DefaultPasswordPolicy.MaxLength
+	}
+	if merged.MaxRepeatedChars == 0 {
+		merged.MaxRepeatedChars = DefaultPasswordPolicy.MaxRepeatedChars
+	}
+	if merged.HistoryDepth == 0 {
+		merged.HistoryDepth = DefaultPasswordPolicy.HistoryDepth
+	}
+	if merged.ExpireDays == 0 {
+		merged.ExpireDays = DefaultPasswordPolicy.ExpireDays
+	}
+	return &merged
+}
+
+// loadPasswordDenylist reads a denylist file once per distinct path and
+// caches the result, so organizations with different DenylistFile settings
+// don't shadow each other's list.
+func loadPasswordDenylist(path string) map[string]bool {
+	if path == "" {
+		return nil
+	}
+
+	passwordDenylistCacheMu.Lock()
+	defer passwordDenylistCacheMu.Unlock()
+
+	if denylist, ok := passwordDenylistCache[path]; ok {
+		return denylist
+	}
+
+	denylist := map[string]bool{}
+	file, err := os.Open(path)
+	if err != nil {
+		passwordDenylistCache[path] = denylist
+		return denylist
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line != "" {
+			denylist[line] = true
+		}
+	}
+
+	passwordDenylistCache[path] = denylist
+	return denylist
+}
+
+func hasRepeatedOrSequentialRun(password string, maxRun int) bool {
+	if maxRun <= 0 {
+		return false
+	}
+
+	runeList := []rune(password)
+	repeated, sequential := 1, 1
+	for i := 1; i < len(runeList); i++ {
+		if runeList[i] == runeList[i-1] {
+			repeated++
+		} else {
+			repeated = 1
+		}
+
+		if runeList[i] == runeList[i-1]+1 {
+			sequential++
+		} else {
+			sequential = 1
+		}
+
+		if repeated > maxRun || sequential > maxRun {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsUserIdentity(password string, user *User) bool {
+	lowerPassword := strings.ToLower(password)
+	for _, identity := range []string{user.Name, user.Email, user.DisplayName} {
+		if identity != "" && strings.Contains(lowerPassword, strings.ToLower(identity)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePassword checks the given password against organization's
+// PasswordPolicy: complexity, denylist, identity reuse, and history. It is
+// shared by signup, admin-set-password and self-service reset paths. A nil
+// user is allowed for signup, where no history or identity check applies
+// yet.
+func ValidatePassword(organization *Organization, user *User, password string, lang string) string {
+	policy := getPasswordPolicy(organization)
+
+	if len(password) < policy.MinLength {
+		return i18n.Translate(lang, "UserErr.PasswordTooShort")
+	}
+	if policy.MaxLength > 0 && len(password) > policy.MaxLength {
+		return i18n.Translate(lang, "UserErr.PasswordTooLong")
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireLowercase && !hasLower {
+		return i18n.Translate(lang, "UserErr.PasswordRequireLowercase")
+	}
+	if policy.RequireUppercase && !hasUpper {
+		return i18n.Translate(lang, "UserErr.PasswordRequireUppercase")
+	}
+	if policy.RequireDigit && !hasDigit {
+		return i18n.Translate(lang, "UserErr.PasswordRequireDigit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		return i18n.Translate(lang, "UserErr.PasswordRequireSymbol")
+	}
+
+	if hasRepeatedOrSequentialRun(password, policy.MaxRepeatedChars) {
+		return i18n.Translate(lang, "UserErr.PasswordTooManyRepeatedChars")
+	}
+
+	if denylist := loadPasswordDenylist(policy.DenylistFile); denylist[strings.ToLower(password)] {
+		return i18n.Translate(lang, "UserErr.PasswordInDenylist")
+	}
+
+	if user != nil {
+		if containsUserIdentity(password, user) {
+			return i18n.Translate(lang, "UserErr.PasswordContainsIdentity")
+		}
+
+		if policy.HistoryDepth > 0 && isPasswordInHistory(organization, user, password, policy.HistoryDepth) {
+			return i18n.Translate(lang, "UserErr.PasswordReused")
+		}
+	}
+
+	return ""
+}
+
+// checkPasswordExpiry returns a non-empty i18n error if ExpireDays is set and
+// the user's password was last changed more than that many days ago, forcing
+// a reset through SetUserPassword before signin can complete.
+func checkPasswordExpiry(organization *Organization, user *User, lang string) string {
+	policy := getPasswordPolicy(organization)
+	if policy.ExpireDays <= 0 || user.PasswordUpdatedTime == "" {
+		return ""
+	}
+
+	updatedTime, err := time.Parse(time.RFC3339, user.PasswordUpdatedTime)
+	if err != nil {
+		return ""
+	}
+
+	if time.Since(updatedTime) > time.Duration(policy.ExpireDays)*24*time.Hour {
+		return i18n.Translate(lang, "UserErr.PasswordExpired")
+	}
+
+	return ""
+}
+
+// isPasswordInHistory reports whether password matches the user's current
+// live password or any of their last historyDepth-1 previous ones. The
+// current password is checked separately because it is only pushed into
+// UserPasswordHistory by AddPasswordToHistory once SetUserPassword actually
+// overwrites it — by the time ValidatePassword runs, the most recently used
+// password is still just user.Password, not yet a history row.
+func isPasswordInHistory(organization *Organization, user *User, password string, historyDepth int) bool {
+	credManager := cred.GetCredManager(organization.PasswordType)
+	if credManager == nil {
+		return false
+	}
+
+	if user.Password != "" && credManager.IsPasswordCorrect(password, user.Password, user.PasswordSalt, organization.PasswordSalt) {
+		return true
+	}
+	if historyDepth <= 1 {
+		return false
+	}
+
+	histories := []*UserPasswordHistory{}
+	err := adapter.Engine.Where("owner = ? AND name = ?", user.Owner, user.Name).
+		Desc("created_time").Limit(historyDepth - 1).Find(&histories)
+	if err != nil {
+		return false
+	}
+
+	for _, history := range histories {
+		if credManager.IsPasswordCorrect(password, history.Password, history.PasswordSalt, organization.PasswordSalt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddPasswordToHistory records the user's current password hash so future
+// ValidatePassword calls can enforce HistoryDepth. It should be called right
+// before the user's password is overwritten.
+func AddPasswordToHistory(user *User) error {
+	if user.Password == "" {
+		return nil
+	}
+
+	history := &UserPasswordHistory{
+		Owner:        user.Owner,
+		Name:         user.Name,
+		Password:     user.Password,
+		PasswordSalt: user.PasswordSalt,
+		CreatedTime:  util.GetCurrentTime(),
+	}
+	_, err := adapter.Engine.Insert(history)
+	return err
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"fmt"
+
+	"github.com/casdoor/casdoor/cred"
+	"github.com/casdoor/casdoor/i18n"
+	"github.com/casdoor/casdoor/util"
+)
+
+// SetUserPassword overwrites user's password, enforcing the organization's
+// PasswordPolicy first. It is the single path both the admin "set password"
+// API and the self-service "reset password" flow must call, so neither one
+// can bypass complexity/denylist/history rules the way signup already does
+// via ValidatePassword.
+func SetUserPassword(organization *Organization, user *User, newPassword string, lang string) string {
+	if msg := ValidatePassword(organization, user, newPassword, lang); msg != "" {
+		return msg
+	}
+
+	credManager := cred.GetCredManager(organization.PasswordType)
+	if credManager == nil {
+		return fmt.Sprintf(i18n.Translate(lang, "LoginErr.UnsupportedPasswordType"), organization.PasswordType)
+	}
+
+	if err := AddPasswordToHistory(user); err != nil {
+		return i18n.Translate(lang, "UserErr.PasswordResetFailed")
+	}
+
+	hashedPassword, salt := credManager.GetHashedPassword(newPassword, organization.PasswordSalt)
+	user.Password = hashedPassword
+	user.PasswordSalt = salt
+	user.PasswordUpdatedTime = util.GetCurrentTime()
+
+	_, err := UpdateUser(user.GetId(), user, []string{"password", "password_salt", "password_updated_time"}, user.IsGlobalAdmin)
+	if err != nil {
+		return i18n.Translate(lang, "UserErr.PasswordResetFailed")
+	}
+
+	return ""
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+// Permission describes who (Users) may do what (Actions) to which
+// applications (Resources), enforced through the Casbin model named Model.
+type Permission struct {
+	Owner     string   `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name      string   `xorm:"varchar(100) notnull pk" json:"name"`
+	IsEnabled bool     `xorm:"bool" json:"isEnabled"`
+	Users     []string `xorm:"mediumtext" json:"users"`
+	Resources []string `xorm:"mediumtext" json:"resources"`
+	Actions   []string `xorm:"mediumtext" json:"actions"`
+	Model     string   `xorm:"varchar(100)" json:"model"`
+}
+
+func (permission *Permission) GetId() string {
+	return permission.Owner + "/" + permission.Name
+}
+
+// GetPermissions returns every permission belonging to owner.
+func GetPermissions(owner string) []*Permission {
+	permissions := []*Permission{}
+	err := adapter.Engine.Where("owner = ?", owner).Find(&permissions)
+	if err != nil {
+		return []*Permission{}
+	}
+	return permissions
+}
+
+// UpdatePermission persists changes to an existing permission. Permission
+// changes can add, remove, or re-scope policies enforced for an
+// application, so the merged-enforcer and decision caches must be dropped
+// afterwards to avoid serving stale access decisions.
+func UpdatePermission(id string, permission *Permission) (bool, error) {
+	affected, err := adapter.Engine.Id(id).AllCols().Update(permission)
+	if err != nil {
+		return false, err
+	}
+	if affected != 0 {
+		invalidatePermissionCaches()
+	}
+	return affected != 0, nil
+}
+
+// AddPermission inserts a new permission and invalidates the caches that
+// would otherwise keep serving access decisions computed without it.
+func AddPermission(permission *Permission) (bool, error) {
+	affected, err := adapter.Engine.Insert(permission)
+	if err != nil {
+		return false, err
+	}
+	if affected != 0 {
+		invalidatePermissionCaches()
+	}
+	return affected != 0, nil
+}
+
+// DeletePermission removes a permission and invalidates the caches so its
+// policies stop being enforced immediately.
+func DeletePermission(permission *Permission) (bool, error) {
+	affected, err := adapter.Engine.Id(permission.GetId()).Delete(&Permission{})
+	if err != nil {
+		return false, err
+	}
+	if affected != 0 {
+		invalidatePermissionCaches()
+	}
+	return affected != 0, nil
+}
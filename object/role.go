@@ -0,0 +1,86 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+// Role groups users under a name that permission Users lists and the
+// "role:" wildcard subject matcher can reference.
+type Role struct {
+	Owner string   `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name  string   `xorm:"varchar(100) notnull pk" json:"name"`
+	Users []string `xorm:"mediumtext" json:"users"`
+}
+
+func (role *Role) GetId() string {
+	return role.Owner + "/" + role.Name
+}
+
+// GetRolesByUser returns every role that lists userId as a member, used by
+// matchesWildcardSubject's "role:" matching.
+func GetRolesByUser(userId string) []*Role {
+	roles := []*Role{}
+	err := adapter.Engine.Find(&roles)
+	if err != nil {
+		return []*Role{}
+	}
+
+	result := make([]*Role, 0, len(roles))
+	for _, role := range roles {
+		for _, member := range role.Users {
+			if member == userId {
+				result = append(result, role)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// UpdateRole persists changes to an existing role's membership and
+// invalidates the merged-enforcer and decision caches, since "role:"
+// subjects depend on up-to-date membership.
+func UpdateRole(id string, role *Role) (bool, error) {
+	affected, err := adapter.Engine.Id(id).AllCols().Update(role)
+	if err != nil {
+		return false, err
+	}
+	if affected != 0 {
+		invalidatePermissionCaches()
+	}
+	return affected != 0, nil
+}
+
+// AddRole inserts a new role and invalidates the permission caches.
+func AddRole(role *Role) (bool, error) {
+	affected, err := adapter.Engine.Insert(role)
+	if err != nil {
+		return false, err
+	}
+	if affected != 0 {
+		invalidatePermissionCaches()
+	}
+	return affected != 0, nil
+}
+
+// DeleteRole removes a role and invalidates the permission caches.
+func DeleteRole(role *Role) (bool, error) {
+	affected, err := adapter.Engine.Id(role.GetId()).Delete(&Role{})
+	if err != nil {
+		return false, err
+	}
+	if affected != 0 {
+		invalidatePermissionCaches()
+	}
+	return affected != 0, nil
+}
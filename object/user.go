@@ -0,0 +1,55 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+// User represents one Casdoor account. Only the fields touched by the
+// signin, lockout, password-policy and WebAuthn code paths are declared
+// here.
+type User struct {
+	Owner       string `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name        string `xorm:"varchar(100) notnull pk" json:"name"`
+	DisplayName string `xorm:"varchar(100)" json:"displayName"`
+	Avatar      string `xorm:"varchar(255)" json:"avatar"`
+	Email       string `xorm:"varchar(100) index" json:"email"`
+	Groups      []string `xorm:"mediumtext" json:"groups"`
+
+	Password     string `xorm:"varchar(255)" json:"-"`
+	PasswordSalt string `xorm:"varchar(100)" json:"-"`
+
+	// PasswordUpdatedTime is stamped whenever SetUserPassword overwrites
+	// Password, so PasswordPolicy.ExpireDays can be enforced against it.
+	PasswordUpdatedTime string `xorm:"varchar(100)" json:"passwordUpdatedTime"`
+
+	Ldap string `xorm:"varchar(100)" json:"ldap"`
+
+	IsDeleted     bool `xorm:"bool" json:"isDeleted"`
+	IsForbidden   bool `xorm:"bool" json:"isForbidden"`
+	IsGlobalAdmin bool `xorm:"bool" json:"isGlobalAdmin"`
+	IsAdmin       bool `xorm:"bool" json:"isAdmin"`
+
+	SigninWrongTimes    int    `xorm:"int" json:"signinWrongTimes"`
+	LastSigninWrongTime string `xorm:"varchar(100)" json:"lastSigninWrongTime"`
+
+	// LockoutUntil/LockoutLevel back the per-organization LockoutPolicy:
+	// LockoutUntil is the RFC3339 timestamp the account stays locked until,
+	// and LockoutLevel is how many times in a row it has been locked,
+	// which drives the escalating lock duration.
+	LockoutUntil string `xorm:"varchar(100)" json:"lockoutUntil"`
+	LockoutLevel int    `xorm:"int" json:"lockoutLevel"`
+}
+
+func (user *User) GetId() string {
+	return user.Owner + "/" + user.Name
+}
@@ -0,0 +1,267 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor/conf"
+	"github.com/casdoor/casdoor/util"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// UserCredential persists one registered FIDO2/WebAuthn authenticator for a
+// user, either as a second factor or as a passwordless primary credential.
+type UserCredential struct {
+	Id              int64  `xorm:"pk autoincr" json:"id"`
+	Owner           string `xorm:"varchar(100) index" json:"owner"`
+	Name            string `xorm:"varchar(100) index" json:"name"`
+	CredentialId    string `xorm:"varchar(255) unique" json:"credentialId"`
+	PublicKey       string `xorm:"text" json:"-"`
+	AttestationType string `xorm:"varchar(100)" json:"attestationType"`
+	Aaguid          string `xorm:"varchar(100)" json:"aaguid"`
+	SignCount       uint32 `xorm:"int" json:"signCount"`
+	Transports      string `xorm:"varchar(255)" json:"transports"` // comma-separated
+	DisplayName     string `xorm:"varchar(100)" json:"displayName"`
+	IsRevoked       bool   `xorm:"bool" json:"isRevoked"`
+	CreatedTime     string `xorm:"varchar(100)" json:"createdTime"`
+	LastUsedTime    string `xorm:"varchar(100)" json:"lastUsedTime"`
+}
+
+var (
+	webAuthnInstance *webauthn.WebAuthn
+	webAuthnOnce     sync.Once
+)
+
+// GetWebAuthnInstance lazily builds the shared webauthn.WebAuthn config from
+// the server's configured origin, matching how other third-party client
+// singletons are built in this package.
+func GetWebAuthnInstance() *webauthn.WebAuthn {
+	webAuthnOnce.Do(func() {
+		origin := conf.GetConfigString("origin")
+		webAuthnInstance, _ = webauthn.New(&webauthn.Config{
+			RPDisplayName: "Casdoor",
+			RPID:          util.GetHostFromUrl(origin),
+			RPOrigins:     []string{origin},
+		})
+	})
+	return webAuthnInstance
+}
+
+// WebauthnUser adapts a Casdoor User and its enrolled credentials to the
+// webauthn.User interface expected by the go-webauthn library.
+type WebauthnUser struct {
+	user        *User
+	credentials []*UserCredential
+}
+
+func NewWebauthnUser(user *User) *WebauthnUser {
+	credentials, _ := GetUserCredentials(user.Owner, user.Name)
+	return &WebauthnUser{user: user, credentials: credentials}
+}
+
+func (w *WebauthnUser) WebAuthnID() []byte {
+	return []byte(w.user.GetId())
+}
+
+func (w *WebauthnUser) WebAuthnName() string {
+	return w.user.Name
+}
+
+func (w *WebauthnUser) WebAuthnDisplayName() string {
+	return w.user.DisplayName
+}
+
+func (w *WebauthnUser) WebAuthnIcon() string {
+	return w.user.Avatar
+}
+
+func (w *WebauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	result := make([]webauthn.Credential, 0, len(w.credentials))
+	for _, c := range w.credentials {
+		credentialId, err := base64.RawURLEncoding.DecodeString(c.CredentialId)
+		if err != nil {
+			continue
+		}
+		result = append(result, webauthn.Credential{
+			ID:        credentialId,
+			PublicKey: []byte(c.PublicKey),
+			Authenticator: webauthn.Authenticator{
+				SignCount: c.SignCount,
+				AAGUID:    []byte(c.Aaguid),
+			},
+		})
+	}
+	return result
+}
+
+// NewUserCredentialFromWebauthn converts a freshly registered
+// webauthn.Credential into the row persisted by AddUserCredential.
+func NewUserCredentialFromWebauthn(user *User, credential *webauthn.Credential, displayName string) *UserCredential {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return &UserCredential{
+		Owner:           user.Owner,
+		Name:            user.Name,
+		CredentialId:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       string(credential.PublicKey),
+		AttestationType: credential.AttestationType,
+		Aaguid:          string(credential.Authenticator.AAGUID),
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		DisplayName:     displayName,
+	}
+}
+
+// GetUserCredentialByWebauthnId finds the enrolled credential matching the
+// raw credential ID returned by a completed assertion.
+func GetUserCredentialByWebauthnId(user *User, credentialId []byte) *UserCredential {
+	encodedId := base64.RawURLEncoding.EncodeToString(credentialId)
+	credentials, err := GetUserCredentials(user.Owner, user.Name)
+	if err != nil {
+		return nil
+	}
+	for _, c := range credentials {
+		if c.CredentialId == encodedId {
+			return c
+		}
+	}
+	return nil
+}
+
+// GetUserCredentials returns every non-revoked credential enrolled by a
+// user, for use both in WebAuthn ceremonies and the self-service management
+// page.
+func GetUserCredentials(owner, name string) ([]*UserCredential, error) {
+	credentials := []*UserCredential{}
+	err := adapter.Engine.Where("owner = ? AND name = ? AND is_revoked = ?", owner, name, false).Find(&credentials)
+	if err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// GetUserCredentialById looks up a single enrolled credential by its
+// numeric id, for callers (like RevokeWebAuthnCredential) that must confirm
+// the caller actually owns it before acting on it.
+func GetUserCredentialById(id int64) *UserCredential {
+	credential := &UserCredential{}
+	existed, err := adapter.Engine.Id(id).Get(credential)
+	if err != nil || !existed {
+		return nil
+	}
+	return credential
+}
+
+// HasEnrolledWebAuthnCredential reports whether the user has at least one
+// usable WebAuthn credential, used by CheckUserPassword to decide whether to
+// require a second factor.
+func HasEnrolledWebAuthnCredential(owner, name string) bool {
+	credentials, err := GetUserCredentials(owner, name)
+	return err == nil && len(credentials) > 0
+}
+
+// AddUserCredential persists a newly registered credential at the end of
+// the registration-finish ceremony.
+func AddUserCredential(credential *UserCredential) (bool, error) {
+	credential.CreatedTime = util.GetCurrentTime()
+	affected, err := adapter.Engine.Insert(credential)
+	if err != nil {
+		return false, err
+	}
+	return affected != 0, nil
+}
+
+// RevokeUserCredential marks a credential as revoked so it can no longer be
+// used to sign in, either by explicit user action or because
+// CheckCredentialCloning detected a sign-count regression.
+func RevokeUserCredential(id int64) (bool, error) {
+	affected, err := adapter.Engine.Id(id).Cols("is_revoked").Update(&UserCredential{IsRevoked: true})
+	if err != nil {
+		return false, err
+	}
+	return affected != 0, nil
+}
+
+// CheckCredentialCloning compares the sign count reported by the
+// authenticator on this assertion against the last stored value. FIDO2
+// authenticators must report a strictly increasing counter; any value that
+// is not greater than what we have on file indicates the credential may
+// have been cloned, so it is revoked rather than trusted.
+func CheckCredentialCloning(credential *UserCredential, newSignCount uint32) bool {
+	if newSignCount == 0 && credential.SignCount == 0 {
+		// some authenticators never increment the counter; treat as benign
+		return false
+	}
+	if newSignCount <= credential.SignCount {
+		RevokeUserCredential(credential.Id)
+		return true
+	}
+	return false
+}
+
+// UpdateUserCredentialUsage persists the authenticator's new sign count and
+// last-used timestamp after a successful assertion.
+func UpdateUserCredentialUsage(credential *UserCredential, newSignCount uint32) error {
+	credential.SignCount = newSignCount
+	credential.LastUsedTime = util.GetCurrentTime()
+	_, err := adapter.Engine.Id(credential.Id).Cols("sign_count", "last_used_time").Update(credential)
+	return err
+}
+
+// webauthnChallengeStore holds in-flight registration/assertion challenges
+// keyed by a short-lived session id, since webauthn.SessionData must survive
+// between the "begin" and "finish" legs of the ceremony.
+type webauthnChallengeStore struct {
+	mu       sync.Mutex
+	sessions map[string]*webauthnChallengeEntry
+}
+
+type webauthnChallengeEntry struct {
+	data      *webauthn.SessionData
+	expiresAt time.Time
+}
+
+var webauthnSessions = &webauthnChallengeStore{sessions: map[string]*webauthnChallengeEntry{}}
+
+const webauthnChallengeTtl = 5 * time.Minute
+
+// StoreWebauthnSessionData stashes the challenge generated by begin
+// registration/login until the matching finish call arrives.
+func StoreWebauthnSessionData(sessionId string, data *webauthn.SessionData) {
+	webauthnSessions.mu.Lock()
+	defer webauthnSessions.mu.Unlock()
+	webauthnSessions.sessions[sessionId] = &webauthnChallengeEntry{data: data, expiresAt: time.Now().Add(webauthnChallengeTtl)}
+}
+
+// PopWebauthnSessionData retrieves and clears a previously stored
+// challenge, returning ok=false if it is missing or has expired.
+func PopWebauthnSessionData(sessionId string) (*webauthn.SessionData, bool) {
+	webauthnSessions.mu.Lock()
+	defer webauthnSessions.mu.Unlock()
+
+	entry, ok := webauthnSessions.sessions[sessionId]
+	delete(webauthnSessions.sessions, sessionId)
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.data, true
+}